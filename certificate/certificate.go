@@ -3,6 +3,7 @@ package certificate
 import (
 	"crypto/dsa"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/md5"
 	"crypto/rsa"
 	"crypto/sha1"
@@ -17,6 +18,13 @@ import (
 	"time"
 )
 
+// The names of the trust stores Observatory originally shipped with.
+//
+// Deprecated: these are no longer the only trust stores a certificate can
+// be validated against; call RegisterTrustStore to add any other PEM
+// bundle, NSS certdata.txt, or Java JKS keystore, and look up
+// its result in Certificate.ValidationInfo by the name it was registered
+// under.
 const (
 	Ubuntu_TS_name    = "Ubuntu"
 	Mozilla_TS_name   = "Mozilla"
@@ -26,27 +34,32 @@ const (
 )
 
 type Certificate struct {
-	ID                     int64                     `json:"id"`
-	Serial                 string                    `json:"serialNumber,omitempty"`
-	ScanTarget             string                    `json:"scanTarget,omitempty"`
-	IPs                    []string                  `json:"ips,omitempty"`
-	Version                int                       `json:"version,omitempty"`
-	SignatureAlgorithm     string                    `json:"signatureAlgorithm,omitempty"`
-	Issuer                 Subject                   `json:"issuer,omitempty"`
-	Validity               Validity                  `json:"validity,omitempty"`
-	Subject                Subject                   `json:"subject,omitempty"`
-	Key                    SubjectPublicKeyInfo      `json:"key,omitempty"`
-	X509v3Extensions       Extensions                `json:"x509v3Extensions,omitempty"`
-	X509v3BasicConstraints string                    `json:"x509v3BasicConstraints,omitempty"`
-	CA                     bool                      `json:"ca,omitempty"`
-	Analysis               interface{}               `json:"analysis,omitempty"` //for future use...
-	ParentSignature        []string                  `json:"parentSignature,omitempty"`
-	ValidationInfo         map[string]ValidationInfo `json:"validationInfo,omitempty"`
-	FirstSeenTimestamp     time.Time                 `json:"firstSeenTimestamp"`
-	LastSeenTimestamp      time.Time                 `json:"lastSeenTimestamp"`
-	Hashes                 Hashes                    `json:"hashes,omitempty"`
-	Raw                    string                    `json:"Raw,omitempty"`
-	Anomalies              string                    `json:"anomalies,omitempty"`
+	ID                     int64                          `json:"id"`
+	Serial                 string                         `json:"serialNumber,omitempty"`
+	ScanTarget             string                         `json:"scanTarget,omitempty"`
+	IPs                    []string                       `json:"ips,omitempty"`
+	Version                int                            `json:"version,omitempty"`
+	SignatureAlgorithm     string                         `json:"signatureAlgorithm,omitempty"`
+	Issuer                 Subject                        `json:"issuer,omitempty"`
+	Validity               Validity                       `json:"validity,omitempty"`
+	Subject                Subject                        `json:"subject,omitempty"`
+	Key                    SubjectPublicKeyInfo           `json:"key,omitempty"`
+	X509v3Extensions       Extensions                     `json:"x509v3Extensions,omitempty"`
+	X509v3BasicConstraints string                         `json:"x509v3BasicConstraints,omitempty"`
+	CA                     bool                           `json:"ca,omitempty"`
+	Analysis               interface{}                    `json:"analysis,omitempty"` //for future use...
+	ParentSignature        []string                       `json:"parentSignature,omitempty"`
+	ValidationInfo         map[string]ValidationInfo      `json:"validationInfo,omitempty"`
+	FirstSeenTimestamp     time.Time                      `json:"firstSeenTimestamp"`
+	LastSeenTimestamp      time.Time                      `json:"lastSeenTimestamp"`
+	Hashes                 Hashes                         `json:"hashes,omitempty"`
+	Raw                    string                         `json:"Raw,omitempty"`
+	Anomalies              string                         `json:"anomalies,omitempty"`
+	SCTs                   []SCTInfo                      `json:"scts,omitempty"`
+	IsPrecertificate       bool                           `json:"isPrecertificate,omitempty"`
+	ParseWarnings          []string                       `json:"parseWarnings,omitempty"`
+	SCTValidation          map[string]SCTValidationResult `json:"sctValidation,omitempty"`
+	Revocation             Revocation                     `json:"revocation,omitempty"`
 }
 
 type Hashes struct {
@@ -82,7 +95,9 @@ type SubjectPublicKeyInfo struct {
 	Curve    string  `json:"curve,omitempty"`
 }
 
-//Currently exporting extensions that are already decoded into the x509 Certificate structure
+// Extensions exports the extensions already decoded into the x509 Certificate
+// structure, plus every extension in raw form (RawExtensions) and the OIDs of
+// critical extensions nothing could decode (UnhandledCriticalExtensions).
 type Extensions struct {
 	AuthorityKeyId         string   `json:"authorityKeyId,omitempty"`
 	SubjectKeyId           string   `json:"subjectKeyId,omitempty"`
@@ -93,6 +108,9 @@ type Extensions struct {
 	PolicyIdentifiers      []string `json:"policyIdentifiers,omitempty"`
 	IsNameConstrained      bool     `json:"isNameConstrained,omitempty"`
 	PermittedNames         []string `json:"permittedNames,omitempty"`
+
+	RawExtensions               []RawExtension `json:"rawExtensions,omitempty"`
+	UnhandledCriticalExtensions []string       `json:"unhandledCriticalExtensions,omitempty"`
 }
 
 type X509v3BasicConstraints struct {
@@ -125,6 +143,13 @@ type ValidationInfo struct {
 	ValidationError string `json:"validationError,omitempty"`
 }
 
+// Trust is the legacy fixed-column representation of per-store validity,
+// limited to the five trust stores Observatory originally shipped with.
+//
+// Deprecated: use Certificate.ValidationInfo (keyed by the name passed to
+// RegisterTrustStore) or Certificate.TrustMap, which cover any registered
+// store rather than just these five. ToTrust/TrustFromMap bridge existing
+// readers built around this schema to the registry-based API.
 type Trust struct {
 	ID               int64
 	CertID           int64
@@ -152,6 +177,10 @@ var SignatureAlgorithm = [...]string{
 	"ECDSAWithSHA256",
 	"ECDSAWithSHA384",
 	"ECDSAWithSHA512",
+	"SHA256WithRSAPSS",
+	"SHA384WithRSAPSS",
+	"SHA512WithRSAPSS",
+	"PureEd25519",
 }
 
 var ExtKeyUsage = [...]string{
@@ -174,6 +203,7 @@ var PublicKeyAlgorithm = [...]string{
 	"RSA",
 	"DSA",
 	"ECDSA",
+	"Ed25519",
 }
 
 func SHA256SubjectSPKI(cert *x509.Certificate) string {
@@ -195,6 +225,16 @@ func PKPSHA256Hash(cert *x509.Certificate) string {
 	case *ecdsa.PublicKey:
 		der, _ := x509.MarshalPKIXPublicKey(pub)
 		h.Write(der)
+	case ed25519.PublicKey:
+		der, _ := x509.MarshalPKIXPublicKey(pub)
+		h.Write(der)
+	default:
+		// crypto/x509 doesn't recognize algorithms like SM2, leaving
+		// cert.PublicKey nil; fall back to re-marshaling the raw
+		// SubjectPublicKeyInfo straight off the certificate.
+		if der, err := marshalRawSPKI(cert.RawSubjectPublicKeyInfo); err == nil {
+			h.Write(der)
+		}
 	}
 	return base64.StdEncoding.EncodeToString(h.Sum(nil))
 }
@@ -214,7 +254,10 @@ func SHA1Hash(data []byte) string {
 	return fmt.Sprintf("%X", h[:])
 }
 
-//GetBooleanValidity converts the validation info map to DB booleans
+// GetBooleanValidity converts the validation info map to DB booleans
+//
+// Deprecated: use Certificate.TrustMap, which covers any store registered
+// via RegisterTrustStore rather than just these five.
 func (c Certificate) GetBooleanValidity() (trusted_ubuntu, trusted_mozilla, trusted_microsoft, trusted_apple, trusted_android bool) {
 
 	//check Ubuntu validation info
@@ -265,6 +308,9 @@ func (c Certificate) GetBooleanValidity() (trusted_ubuntu, trusted_mozilla, trus
 }
 
 // GetValidityMap converts boolean validity variables to a validity map.
+//
+// Deprecated: build a map[string]ValidationInfo keyed by RegisterTrustStore
+// name directly instead of pinning to these five stores.
 func GetValidityMap(trusted_ubuntu, trusted_mozilla, trusted_microsoft, trusted_apple, trusted_android bool) map[string]ValidationInfo {
 
 	vUbuntu := ValidationInfo{IsValid: trusted_ubuntu}
@@ -349,8 +395,9 @@ func getKeyUsages(cert *x509.Certificate) []string {
 	return usage
 }
 
-//getCertExtensions currently stores only the extensions that are already exported by GoLang
-//(in the x509 Certificate Struct)
+// getCertExtensions stores the extensions that are already exported by GoLang
+// (in the x509 Certificate Struct), plus a raw dump of every extension from
+// getRawExtensions
 func getCertExtensions(cert *x509.Certificate) Extensions {
 	// initialize []string to store them as `[]` instead of null
 	san := make([]string, 0)
@@ -372,6 +419,7 @@ func getCertExtensions(cert *x509.Certificate) Extensions {
 	if len(ext.PermittedNames) > 0 {
 		ext.IsNameConstrained = true
 	}
+	ext.RawExtensions, ext.UnhandledCriticalExtensions = getRawExtensions(cert)
 	return ext
 }
 
@@ -424,30 +472,65 @@ func getPublicKeyInfo(cert *x509.Certificate) (SubjectPublicKeyInfo, error) {
 		pubInfo.Curve = pub.Curve.Params().Name
 		pubInfo.Y = pub.Y.String()
 		pubInfo.X = pub.X.String()
+
+	case ed25519.PublicKey:
+		pubInfo.Size = float64(len(pub) * 8)
+		pubInfo.X = hex.EncodeToString(pub)
+
+	default:
+		// crypto/x509 doesn't recognize the SM2 public key OID, so
+		// cert.PublicKey is left nil; re-derive the key ourselves from
+		// the certificate's raw SubjectPublicKeyInfo.
+		if x, y, err := parseSM2PublicKey(cert.RawSubjectPublicKeyInfo); err == nil {
+			pubInfo.Alg = "SM2"
+			pubInfo.Curve = sm2Curve.Params().Name
+			pubInfo.Size = float64(sm2Curve.Params().BitSize)
+			pubInfo.X = x.String()
+			pubInfo.Y = y.String()
+		}
 	}
 
 	return pubInfo, nil
 
 }
 
-//certtoStored returns a Certificate struct created from a X509.Certificate
-func CertToStored(cert *x509.Certificate, parentSignature, domain, ip string, TSName string, valInfo *ValidationInfo) Certificate {
+// certToStored returns a Certificate struct created from an x509.Certificate,
+// collecting any recoverable issue it hits along the way as a non-fatal
+// error instead of dropping the affected data or aborting. CertToStored and
+// CertToStoredLax are both thin wrappers around this.
+func certToStored(cert *x509.Certificate, intermediates []*x509.Certificate, parentSignature, domain, ip string, TSName string, valInfo *ValidationInfo) (Certificate, NonFatalErrors) {
 	var (
-		err    error
-		stored = Certificate{}
+		err      error
+		stored   = Certificate{}
+		nonFatal NonFatalErrors
 	)
 	// initialize []string to never store them as null
 	stored.ParentSignature = make([]string, 0)
 	stored.IPs = make([]string, 0)
 
 	stored.Version = cert.Version
+
+	if cert.SerialNumber.Sign() < 0 {
+		nonFatal.Append(fmt.Errorf("certificate has a negative serial number"))
+	}
 	stored.Serial = strings.ToUpper(hex.EncodeToString(cert.SerialNumber.Bytes()))
-	stored.SignatureAlgorithm = SignatureAlgorithm[cert.SignatureAlgorithm]
+
+	switch {
+	case int(cert.SignatureAlgorithm) < len(SignatureAlgorithm) && cert.SignatureAlgorithm != x509.UnknownSignatureAlgorithm:
+		stored.SignatureAlgorithm = SignatureAlgorithm[cert.SignatureAlgorithm]
+	case isSM2WithSM3(cert):
+		stored.SignatureAlgorithm = "SM2WithSM3"
+	default:
+		nonFatal.Append(fmt.Errorf("unknown signature algorithm identifier %d", cert.SignatureAlgorithm))
+	}
 
 	stored.Key, err = getPublicKeyInfo(cert)
 	if err != nil {
 		log.Printf("Failed to retrieve public key information: %v. Continuing anyway.", err)
 	}
+	if curveErr := checkWeakECDSACurve(cert); curveErr != nil {
+		nonFatal.Append(curveErr)
+	}
 
 	stored.Issuer.Country = cert.Issuer.Country
 	stored.Issuer.Organisation = cert.Issuer.Organization
@@ -461,8 +544,22 @@ func CertToStored(cert *x509.Certificate, parentSignature, domain, ip string, TS
 
 	stored.Validity.NotBefore = cert.NotBefore.UTC()
 	stored.Validity.NotAfter = cert.NotAfter.UTC()
+	if validityErr := checkValidityRange(cert); validityErr != nil {
+		nonFatal.Append(validityErr)
+	}
 
 	stored.X509v3Extensions = getCertExtensions(cert)
+	stored.SCTs, stored.IsPrecertificate = getSCTs(cert)
+
+	for _, sanErr := range checkMalformedSANs(cert) {
+		nonFatal.Append(sanErr)
+	}
+	for _, extErr := range checkUnknownCriticalExtensions(cert) {
+		nonFatal.Append(extErr)
+	}
+	for _, policyErr := range checkPolicyQualifiers(cert) {
+		nonFatal.Append(policyErr)
+	}
 
 	//below check tries to hack around the basic constraints extension
 	//not being available in versions < 3.
@@ -492,8 +589,10 @@ func CertToStored(cert *x509.Certificate, parentSignature, domain, ip string, TS
 		stored.IPs = append(stored.IPs, ip)
 	}
 
-	stored.ValidationInfo = make(map[string]ValidationInfo)
-	stored.ValidationInfo[TSName] = *valInfo
+	stored.ValidationInfo = ValidateAgainstRegistry(cert, intermediates)
+	if TSName != "" {
+		stored.ValidationInfo[TSName] = *valInfo
+	}
 
 	stored.Hashes.MD5 = MD5Hash(cert.Raw)
 	stored.Hashes.SHA1 = SHA1Hash(cert.Raw)
@@ -503,7 +602,34 @@ func CertToStored(cert *x509.Certificate, parentSignature, domain, ip string, TS
 
 	stored.Raw = base64.StdEncoding.EncodeToString(cert.Raw)
 
-	return stored
+	for _, e := range nonFatal.Errors {
+		stored.ParseWarnings = append(stored.ParseWarnings, e.Error())
+	}
+
+	return stored, nonFatal
+}
+
+// CertToStoredLax returns a Certificate struct created from an
+// x509.Certificate, mirroring the CT-fork approach of continuing past
+// recoverable issues (short ECDSA bitlengths, unknown critical extensions,
+// malformed SANs, negative serials, out-of-range validity, unparseable
+// policy qualifiers) instead of silently dropping data or aborting. Any
+// such issue is returned as NonFatalErrors rather than discarded, so the
+// observatory can catalog "weird" certificates in the wild rather than
+// losing them; it is also recorded on Certificate.ParseWarnings.
+func CertToStoredLax(cert *x509.Certificate, intermediates []*x509.Certificate, parentSignature, domain, ip string, TSName string, valInfo *ValidationInfo) (Certificate, NonFatalErrors) {
+	return certToStored(cert, intermediates, parentSignature, domain, ip, TSName, valInfo)
+}
+
+// CertToStored returns a Certificate struct created from an x509.Certificate.
+// It is a thin wrapper over CertToStoredLax that upgrades any non-fatal
+// parsing issue into a hard failure.
+func CertToStored(cert *x509.Certificate, intermediates []*x509.Certificate, parentSignature, domain, ip string, TSName string, valInfo *ValidationInfo) (Certificate, error) {
+	stored, nonFatal := certToStored(cert, intermediates, parentSignature, domain, ip, TSName, valInfo)
+	if nonFatal.IsFatal() {
+		return Certificate{}, nonFatal
+	}
+	return stored, nil
 }
 
 // ToX509() returns the crypto/x509 version of a certificate
@@ -515,8 +641,8 @@ func (cert Certificate) ToX509() (xcert *x509.Certificate, err error) {
 	return x509.ParseCertificate(certRaw)
 }
 
-//printRawCertExtensions Print raw extension info
-//for debugging purposes
+// printRawCertExtensions Print raw extension info
+// for debugging purposes
 func printRawCertExtensions(cert *x509.Certificate) {
 
 	for i, extension := range cert.Extensions {
@@ -0,0 +1,173 @@
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+)
+
+// NonFatalErrors accumulates recoverable issues found while building a
+// Certificate from an x509.Certificate, instead of aborting on the first
+// one. A zero NonFatalErrors (no appended errors) means nothing was wrong.
+type NonFatalErrors struct {
+	Errors []error
+}
+
+// Append records a non-fatal error.
+func (e *NonFatalErrors) Append(err error) {
+	e.Errors = append(e.Errors, err)
+}
+
+// Error satisfies the error interface by joining every recorded issue, so a
+// NonFatalErrors value can be handled like a single error once a caller
+// decides it should be fatal after all.
+func (e NonFatalErrors) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// IsFatal reports whether any non-fatal error was recorded. CertToStored
+// uses it to decide whether to upgrade them into a hard failure.
+func (e NonFatalErrors) IsFatal() bool {
+	return len(e.Errors) > 0
+}
+
+// minECDSABitSize is the smallest ECDSA curve size this package considers
+// acceptable; anything weaker is still recorded, not silently accepted.
+const minECDSABitSize = 224
+
+// checkWeakECDSACurve flags ECDSA keys below minECDSABitSize.
+func checkWeakECDSACurve(cert *x509.Certificate) error {
+	pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil
+	}
+	if size := pub.Curve.Params().BitSize; size < minECDSABitSize {
+		return fmt.Errorf("ECDSA key uses a %d-bit curve, below the %d-bit minimum", size, minECDSABitSize)
+	}
+	return nil
+}
+
+// checkValidityRange flags validity periods that are inverted or clearly
+// out of range, which Go's x509 parser doesn't reject on its own.
+func checkValidityRange(cert *x509.Certificate) error {
+	if cert.NotAfter.Before(cert.NotBefore) {
+		return fmt.Errorf("validity period is inverted: notAfter (%s) is before notBefore (%s)", cert.NotAfter, cert.NotBefore)
+	}
+	if cert.NotBefore.Year() < 1950 || cert.NotAfter.Year() > 9999 {
+		return fmt.Errorf("validity period is out of range: notBefore=%s notAfter=%s", cert.NotBefore, cert.NotAfter)
+	}
+	return nil
+}
+
+// checkMalformedSANs flags subjectAltName entries that parsed but are
+// clearly malformed, e.g. empty or whitespace-only DNS/email names.
+func checkMalformedSANs(cert *x509.Certificate) []error {
+	var errs []error
+	for _, name := range cert.DNSNames {
+		if strings.TrimSpace(name) == "" || strings.ContainsAny(name, " \t\r\n") {
+			errs = append(errs, fmt.Errorf("malformed DNS subjectAltName %q", name))
+		}
+	}
+	for _, email := range cert.EmailAddresses {
+		if !strings.Contains(email, "@") {
+			errs = append(errs, fmt.Errorf("malformed email subjectAltName %q", email))
+		}
+	}
+	for _, u := range cert.URIs {
+		if u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("malformed URI subjectAltName %q", u))
+		}
+	}
+	return errs
+}
+
+// knownCriticalExtensions lists the extension OIDs this package expects to
+// see marked critical; any other critical extension is unrecognized and
+// worth flagging rather than silently ignoring.
+var knownCriticalExtensions = []asn1.ObjectIdentifier{
+	{2, 5, 29, 15}, // keyUsage
+	{2, 5, 29, 19}, // basicConstraints
+	{2, 5, 29, 17}, // subjectAltName
+	{2, 5, 29, 30}, // nameConstraints
+	{2, 5, 29, 32}, // certificatePolicies
+	{2, 5, 29, 36}, // policyConstraints
+	{2, 5, 29, 37}, // extKeyUsage
+	{2, 5, 29, 54}, // inhibitAnyPolicy
+	oidExtensionCTPoison,
+}
+
+// isKnownCriticalExtensionOID reports whether id is one of the extensions
+// this package directly knows how to interpret the critical-constraint
+// semantics of. It does not cover OIDs with a registered RawExtension
+// decoder (see rawext.go) -- those are only "known" once decoding the
+// specific value actually succeeds, which checkUnknownCriticalExtensions
+// verifies itself rather than trusting registry membership alone.
+func isKnownCriticalExtensionOID(id asn1.ObjectIdentifier) bool {
+	for _, oid := range knownCriticalExtensions {
+		if id.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUnknownCriticalExtensions flags critical extensions this package
+// doesn't otherwise understand, so a validator can choose not to trust a
+// certificate whose critical constraints it can't evaluate. This mirrors
+// getRawExtensions' own unhandled-extension logic (rawext.go) exactly: a
+// critical extension is only "handled" once it's in knownCriticalExtensions
+// or a registered decoder actually decodes this extension's value without
+// error -- a decoder merely existing for the OID isn't enough, since a
+// decoder that chokes on malformed DER hasn't evaluated the constraint any
+// more than having no decoder at all.
+func checkUnknownCriticalExtensions(cert *x509.Certificate) []error {
+	var errs []error
+	for _, ext := range cert.Extensions {
+		if !ext.Critical || isKnownCriticalExtensionOID(ext.Id) {
+			continue
+		}
+		_, hasDecoder, decodeErr := decodeExtension(ext.Id.String(), ext.Value)
+		switch {
+		case !hasDecoder:
+			errs = append(errs, fmt.Errorf("unrecognized critical extension %s", ext.Id))
+		case decodeErr != nil:
+			errs = append(errs, fmt.Errorf("critical extension %s has a registered decoder but failed to decode: %v", ext.Id, decodeErr))
+		}
+	}
+	return errs
+}
+
+var oidCertificatePolicies = asn1.ObjectIdentifier{2, 5, 29, 32}
+
+type policyQualifierInfo struct {
+	Id        asn1.ObjectIdentifier
+	Qualifier asn1.RawValue
+}
+
+type policyInformation struct {
+	Id         asn1.ObjectIdentifier
+	Qualifiers []policyQualifierInfo `asn1:"optional"`
+}
+
+// checkPolicyQualifiers walks the raw certificatePolicies extension, which
+// Go's x509 parser reduces to bare policy OIDs, and flags any policy
+// qualifier that fails to parse instead of letting it disappear unnoticed.
+func checkPolicyQualifiers(cert *x509.Certificate) []error {
+	var errs []error
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidCertificatePolicies) {
+			continue
+		}
+		var policies []policyInformation
+		if _, err := asn1.Unmarshal(ext.Value, &policies); err != nil {
+			errs = append(errs, fmt.Errorf("unparseable certificatePolicies extension: %v", err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,182 @@
+package certificate
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"sync"
+)
+
+// RawExtension captures an X.509 extension exactly as it appeared on the
+// certificate, regardless of whether crypto/x509 (or the rest of this
+// package) already surfaces a decoded form of it elsewhere on Certificate.
+// This is what makes non-standard extensions (qcStatements, TLS
+// Must-Staple, enterprise OIDs, ...) visible instead of silently dropped.
+type RawExtension struct {
+	OID      string      `json:"oid"`
+	Critical bool        `json:"critical,omitempty"`
+	Value    string      `json:"value,omitempty"` // base64-encoded extnValue
+	Decoded  interface{} `json:"decoded,omitempty"`
+}
+
+var (
+	extensionDecodersMu sync.RWMutex
+	extensionDecoders   = make(map[string]func([]byte) (interface{}, error))
+)
+
+// RegisterExtensionDecoder adds a best-effort decoder for the extension
+// identified by oid (dotted string form, e.g. "1.3.6.1.5.5.7.1.1"). Its
+// result populates RawExtension.Decoded wherever that OID appears, without
+// requiring a fork of this package. Registering under an OID that already
+// has a decoder replaces it.
+func RegisterExtensionDecoder(oid string, fn func([]byte) (interface{}, error)) {
+	extensionDecodersMu.Lock()
+	defer extensionDecodersMu.Unlock()
+	extensionDecoders[oid] = fn
+}
+
+// decodeExtension runs the registered decoder for oid against value, if
+// any. hasDecoder reports whether a decoder is registered at all for oid;
+// err reports whether that decoder's attempt to parse value failed. The
+// two are distinct: a critical extension with a registered-but-failing
+// decoder has not actually been evaluated, and callers must not treat it
+// the same as one that decoded cleanly.
+func decodeExtension(oid string, value []byte) (decoded interface{}, hasDecoder bool, err error) {
+	extensionDecodersMu.RLock()
+	fn, ok := extensionDecoders[oid]
+	extensionDecodersMu.RUnlock()
+	if !ok {
+		return nil, false, nil
+	}
+	decoded, err = fn(value)
+	return decoded, true, err
+}
+
+// getRawExtensions dumps every extension on cert, decoded where a decoder
+// is registered for its OID, and separately lists the OIDs of any critical
+// extension that neither this package nor a registered decoder actually
+// managed to decode -- a certificate asserting a critical constraint
+// nothing can evaluate should not be treated as if that constraint were
+// satisfied, and that includes a registered decoder that choked on
+// malformed DER just as much as no decoder existing at all.
+func getRawExtensions(cert *x509.Certificate) ([]RawExtension, []string) {
+	raw := make([]RawExtension, 0, len(cert.Extensions))
+	var unhandled []string
+
+	for _, ext := range cert.Extensions {
+		oid := ext.Id.String()
+		decoded, hasDecoder, decodeErr := decodeExtension(oid, ext.Value)
+		if decodeErr != nil {
+			decoded = nil
+		}
+		raw = append(raw, RawExtension{
+			OID:      oid,
+			Critical: ext.Critical,
+			Value:    base64.StdEncoding.EncodeToString(ext.Value),
+			Decoded:  decoded,
+		})
+
+		if ext.Critical && !isKnownCriticalExtensionOID(ext.Id) && !(hasDecoder && decodeErr == nil) {
+			unhandled = append(unhandled, oid)
+		}
+	}
+	return raw, unhandled
+}
+
+// Well-known extension OIDs this package decodes out of the box, beyond
+// what crypto/x509 already exposes structurally.
+var (
+	oidAuthorityInfoAccess = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 1}
+	oidAIAOCSP             = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1}
+	oidAIACAIssuers        = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 2}
+	oidTLSFeature          = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+	oidQCStatements        = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 3}
+)
+
+func init() {
+	RegisterExtensionDecoder(oidExtensionCTPoison.String(), decodeCTPoison)
+	RegisterExtensionDecoder(oidAuthorityInfoAccess.String(), decodeAuthorityInfoAccess)
+	RegisterExtensionDecoder(oidTLSFeature.String(), decodeTLSFeature)
+	RegisterExtensionDecoder(oidQCStatements.String(), decodeQCStatements)
+}
+
+// decodeCTPoison decodes the CT poison extension (RFC 6962 section 3.1),
+// whose value is always an ASN.1 NULL marking a precertificate.
+func decodeCTPoison(value []byte) (interface{}, error) {
+	var null asn1.RawValue
+	if _, err := asn1.Unmarshal(value, &null); err != nil {
+		return nil, err
+	}
+	return "precertificate poison", nil
+}
+
+// AIAInfo is the decoded form of an Authority Information Access
+// extension (RFC 5280 section 4.2.2.1).
+type AIAInfo struct {
+	OCSPServers            []string `json:"ocspServers,omitempty"`
+	IssuingCertificateURLs []string `json:"issuingCertificateUrls,omitempty"`
+}
+
+type accessDescription struct {
+	Method   asn1.ObjectIdentifier
+	Location asn1.RawValue
+}
+
+// decodeAuthorityInfoAccess decodes an Authority Information Access
+// extension into its OCSP responder and issuing-certificate URLs.
+// crypto/x509 already exposes these as cert.OCSPServer/IssuingCertificateURL;
+// this exists so they're also reachable through the generic RawExtensions
+// decoder mechanism.
+func decodeAuthorityInfoAccess(value []byte) (interface{}, error) {
+	var descriptions []accessDescription
+	if _, err := asn1.Unmarshal(value, &descriptions); err != nil {
+		return nil, err
+	}
+
+	var info AIAInfo
+	for _, d := range descriptions {
+		// GeneralName CHOICE, context tag 6 = uniformResourceIdentifier
+		if d.Location.Class != asn1.ClassContextSpecific || d.Location.Tag != 6 {
+			continue
+		}
+		uri := string(d.Location.Bytes)
+		switch {
+		case d.Method.Equal(oidAIAOCSP):
+			info.OCSPServers = append(info.OCSPServers, uri)
+		case d.Method.Equal(oidAIACAIssuers):
+			info.IssuingCertificateURLs = append(info.IssuingCertificateURLs, uri)
+		}
+	}
+	return info, nil
+}
+
+// decodeTLSFeature decodes the TLS Feature extension (RFC 7633), a list of
+// TLS Feature codepoints -- most commonly just [5], the OCSP Must-Staple
+// marker.
+func decodeTLSFeature(value []byte) (interface{}, error) {
+	var features []int
+	if _, err := asn1.Unmarshal(value, &features); err != nil {
+		return nil, err
+	}
+	return features, nil
+}
+
+type qcStatement struct {
+	StatementId   asn1.ObjectIdentifier
+	StatementInfo asn1.RawValue `asn1:"optional"`
+}
+
+// decodeQCStatements decodes the qcStatements extension (ETSI EN 319 412 /
+// RFC 3739) down to the list of asserted statement OIDs; the
+// statement-specific info each one carries is left undecoded.
+func decodeQCStatements(value []byte) (interface{}, error) {
+	var statements []qcStatement
+	if _, err := asn1.Unmarshal(value, &statements); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(statements))
+	for i, s := range statements {
+		ids[i] = s.StatementId.String()
+	}
+	return ids, nil
+}
@@ -0,0 +1,573 @@
+package certificate
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RevocationStatus is the outcome of checking a certificate against a CRL
+// or an OCSP responder.
+type RevocationStatus string
+
+const (
+	RevocationStatusGood    RevocationStatus = "good"
+	RevocationStatusRevoked RevocationStatus = "revoked"
+	RevocationStatusUnknown RevocationStatus = "unknown"
+)
+
+// Revocation records the outcome of checking whether a certificate has
+// been revoked.
+type Revocation struct {
+	Status         RevocationStatus `json:"status,omitempty"`
+	Reason         string           `json:"reason,omitempty"`
+	RevokedAt      *time.Time       `json:"revokedAt,omitempty"`
+	CheckedAt      time.Time        `json:"checkedAt,omitempty"`
+	Source         string           `json:"source,omitempty"` // "CRL" or "OCSP"
+	ResponderURL   string           `json:"responderUrl,omitempty"`
+	SignatureValid bool             `json:"signatureValid,omitempty"`
+}
+
+// RevocationCache lets repeated revocation checks avoid refetching the same
+// CRL. The default used by CheckRevocation is an in-memory cache that
+// treats an entry as stale once past its NextUpdate.
+type RevocationCache interface {
+	Get(url string) (*x509.RevocationList, bool)
+	Set(url string, crl *x509.RevocationList)
+}
+
+type memRevocationCache struct {
+	mu   sync.Mutex
+	crls map[string]*x509.RevocationList
+}
+
+// NewMemRevocationCache returns an in-memory RevocationCache.
+func NewMemRevocationCache() RevocationCache {
+	return &memRevocationCache{crls: make(map[string]*x509.RevocationList)}
+}
+
+func (c *memRevocationCache) Get(url string) (*x509.RevocationList, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	crl, ok := c.crls[url]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(crl.NextUpdate) {
+		return nil, false
+	}
+	return crl, true
+}
+
+func (c *memRevocationCache) Set(url string, crl *x509.RevocationList) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.crls[url] = crl
+}
+
+var defaultRevocationCache = NewMemRevocationCache()
+
+// CheckRevocationOptions configures CheckRevocation. IssuerCert is required
+// to build OCSP requests and to check CRL/OCSP signer signatures; without
+// it, OCSP is skipped and CheckRevocation can still report a CRL match but
+// can't set SignatureValid.
+type CheckRevocationOptions struct {
+	HTTPClient *http.Client
+	Cache      RevocationCache
+	IssuerCert *x509.Certificate
+
+	// TrustStoreName, if set, is looked up via TrustStoreByName; a
+	// CRL/OCSP signer is only reported as SignatureValid if IssuerCert
+	// itself chains to that registered trust store.
+	TrustStoreName string
+}
+
+// CheckRevocation checks whether c has been revoked, trying OCSP (lower
+// latency, more current) before falling back to its CRL distribution
+// points. It returns the first reachable result.
+func (c Certificate) CheckRevocation(ctx context.Context, opts CheckRevocationOptions) (Revocation, error) {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.Cache == nil {
+		opts.Cache = defaultRevocationCache
+	}
+
+	xcert, err := c.ToX509()
+	if err != nil {
+		return Revocation{}, fmt.Errorf("revocation: failed to reparse certificate: %v", err)
+	}
+
+	if rev, err := checkOCSP(ctx, xcert, opts); err == nil {
+		return rev, nil
+	}
+
+	var lastErr error
+	for _, url := range c.X509v3Extensions.CRLDistributionPoints {
+		rev, err := checkCRL(ctx, url, xcert, opts)
+		if err == nil {
+			return rev, nil
+		}
+		lastErr = err
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("revocation: certificate has no OCSP responder or CRL distribution point")
+	}
+	return Revocation{}, lastErr
+}
+
+// issuerTrusted reports whether issuer chains to the named registered
+// trust store. It returns true when no store name was given, since in that
+// case CheckRevocation has nothing to validate the signer chain against
+// beyond the signature itself.
+func issuerTrusted(issuer *x509.Certificate, trustStoreName string) bool {
+	if trustStoreName == "" {
+		return true
+	}
+	ts, ok := TrustStoreByName(trustStoreName)
+	if !ok {
+		return false
+	}
+	_, err := issuer.Verify(x509.VerifyOptions{Roots: ts.Certs})
+	return err == nil
+}
+
+func revocationReasonName(code int) string {
+	names := []string{
+		"Unspecified",
+		"KeyCompromise",
+		"CACompromise",
+		"AffiliationChanged",
+		"Superseded",
+		"CessationOfOperation",
+		"CertificateHold",
+		"",
+		"RemoveFromCRL",
+		"PrivilegeWithdrawn",
+		"AACompromise",
+	}
+	if code >= 0 && code < len(names) && names[code] != "" {
+		return names[code]
+	}
+	return fmt.Sprintf("Unknown(%d)", code)
+}
+
+// --- CRL ---
+
+func checkCRL(ctx context.Context, url string, xcert *x509.Certificate, opts CheckRevocationOptions) (Revocation, error) {
+	crl, ok := opts.Cache.Get(url)
+	if !ok {
+		fetched, err := fetchCRL(ctx, opts.HTTPClient, url)
+		if err != nil {
+			return Revocation{}, err
+		}
+		crl = fetched
+		opts.Cache.Set(url, crl)
+	}
+
+	sigValid := false
+	if opts.IssuerCert != nil {
+		sigValid = crl.CheckSignatureFrom(opts.IssuerCert) == nil && issuerTrusted(opts.IssuerCert, opts.TrustStoreName)
+	}
+
+	rev := Revocation{
+		Status:         RevocationStatusGood,
+		CheckedAt:      time.Now().UTC(),
+		Source:         "CRL",
+		ResponderURL:   url,
+		SignatureValid: sigValid,
+	}
+	for _, entry := range crl.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(xcert.SerialNumber) == 0 {
+			rev.Status = RevocationStatusRevoked
+			rev.Reason = revocationReasonName(entry.ReasonCode)
+			t := entry.RevocationTime.UTC()
+			rev.RevokedAt = &t
+			break
+		}
+	}
+	return rev, nil
+}
+
+func fetchCRL(ctx context.Context, client *http.Client, url string) (*x509.RevocationList, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("crl: unexpected status fetching %s: %s", url, resp.Status)
+	}
+	der, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseRevocationList(der)
+}
+
+// --- OCSP ---
+
+var oidSHA1 = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+
+type certID struct {
+	HashAlgorithm  pkix.AlgorithmIdentifier
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+type ocspSingleRequest struct {
+	ReqCert certID
+}
+
+type ocspTBSRequest struct {
+	RequestList []ocspSingleRequest
+}
+
+type ocspRequestMessage struct {
+	TBSRequest ocspTBSRequest
+}
+
+// buildOCSPRequest builds a minimal (unsigned, SHA-1 CertID) OCSPRequest
+// for xcert, as defined in RFC 6960 section 4.1.1.
+func buildOCSPRequest(xcert, issuer *x509.Certificate) ([]byte, error) {
+	issuerNameHash := sha1.Sum(issuer.RawSubject)
+
+	var spki rawSubjectPublicKeyInfo
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, fmt.Errorf("ocsp: failed to parse issuer public key: %v", err)
+	}
+	issuerKeyHash := sha1.Sum(spki.PublicKey.RightAlign())
+
+	req := ocspRequestMessage{
+		TBSRequest: ocspTBSRequest{
+			RequestList: []ocspSingleRequest{{
+				ReqCert: certID{
+					HashAlgorithm:  pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.RawValue{Tag: asn1.TagNull}},
+					IssuerNameHash: issuerNameHash[:],
+					IssuerKeyHash:  issuerKeyHash[:],
+					SerialNumber:   xcert.SerialNumber,
+				},
+			}},
+		},
+	}
+	return asn1.Marshal(req)
+}
+
+// matchesCertID reports whether id -- as returned in an OCSP response --
+// actually identifies xcert/issuer, rather than some unrelated certificate.
+// An OCSP responder can be misconfigured (or malicious) and return a
+// response for the wrong certificate, and a batched response can legally
+// carry statuses for several certificates at once; checkOCSP must not
+// trust whichever entry happens to come first without checking this.
+func matchesCertID(id certID, xcert, issuer *x509.Certificate) bool {
+	if !id.HashAlgorithm.Algorithm.Equal(oidSHA1) {
+		return false
+	}
+	if id.SerialNumber == nil || xcert.SerialNumber.Cmp(id.SerialNumber) != 0 {
+		return false
+	}
+
+	issuerNameHash := sha1.Sum(issuer.RawSubject)
+	if !bytes.Equal(id.IssuerNameHash, issuerNameHash[:]) {
+		return false
+	}
+
+	var spki rawSubjectPublicKeyInfo
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return false
+	}
+	issuerKeyHash := sha1.Sum(spki.PublicKey.RightAlign())
+	return bytes.Equal(id.IssuerKeyHash, issuerKeyHash[:])
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspResponseASN1 struct {
+	ResponseStatus asn1.Enumerated
+	ResponseBytes  ocspResponseBytes `asn1:"optional,explicit,tag:0"`
+}
+
+type basicOCSPResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certs              []asn1.RawValue `asn1:"optional,explicit,tag:0"`
+}
+
+type ocspSingleResponse struct {
+	CertID     certID
+	CertStatus asn1.RawValue
+	ThisUpdate time.Time
+	NextUpdate time.Time `asn1:"optional,generalized,explicit,tag:0"`
+}
+
+type ocspResponseData struct {
+	Version     int `asn1:"optional,explicit,default:0,tag:0"`
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time
+	Responses   []ocspSingleResponse
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime   time.Time
+	RevocationReason asn1.Enumerated `asn1:"optional,explicit,tag:0"`
+}
+
+// reTagSequence rewrites an IMPLICIT-tagged constructed RawValue (e.g. the
+// CertStatus CHOICE's "revoked" arm) as a plain universal SEQUENCE so it can
+// be unmarshaled with an ordinary struct, since asn1.Unmarshal has no
+// direct support for ASN.1 CHOICE.
+func reTagSequence(raw asn1.RawValue) []byte {
+	b := append([]byte(nil), raw.FullBytes...)
+	if len(b) > 0 {
+		b[0] = 0x30
+	}
+	return b
+}
+
+func parseOCSPResponse(der []byte) (*basicOCSPResponse, *ocspResponseData, error) {
+	var resp ocspResponseASN1
+	if _, err := asn1.Unmarshal(der, &resp); err != nil {
+		return nil, nil, fmt.Errorf("ocsp: failed to parse response: %v", err)
+	}
+	if resp.ResponseStatus != 0 {
+		return nil, nil, fmt.Errorf("ocsp: responder returned non-successful status %d", resp.ResponseStatus)
+	}
+
+	var basic basicOCSPResponse
+	if _, err := asn1.Unmarshal(resp.ResponseBytes.Response, &basic); err != nil {
+		return nil, nil, fmt.Errorf("ocsp: failed to parse BasicOCSPResponse: %v", err)
+	}
+
+	var rd ocspResponseData
+	if _, err := asn1.Unmarshal(basic.TBSResponseData.FullBytes, &rd); err != nil {
+		return nil, nil, fmt.Errorf("ocsp: failed to parse ResponseData: %v", err)
+	}
+	return &basic, &rd, nil
+}
+
+var (
+	oidSignatureSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSignatureECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+// verifyOCSPSignature supports the two signature algorithms seen on the
+// overwhelming majority of OCSP responders in practice; anything else is
+// reported as unverifiable rather than guessed at.
+func verifyOCSPSignature(pub crypto.PublicKey, alg pkix.AlgorithmIdentifier, signedData, sig []byte) error {
+	switch {
+	case alg.Algorithm.Equal(oidSignatureSHA256WithRSA):
+		rsaPub, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("ocsp: responder key type doesn't match its signature algorithm")
+		}
+		digest := sha256.Sum256(signedData)
+		return rsa.VerifyPKCS1v15(rsaPub, crypto.SHA256, digest[:], sig)
+
+	case alg.Algorithm.Equal(oidSignatureECDSAWithSHA256):
+		ecPub, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("ocsp: responder key type doesn't match its signature algorithm")
+		}
+		digest := sha256.Sum256(signedData)
+		if !ecdsa.VerifyASN1(ecPub, digest[:], sig) {
+			return errors.New("ocsp: ECDSA signature verification failed")
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("ocsp: unsupported responder signature algorithm %s", alg.Algorithm)
+	}
+}
+
+// ocspResponderKey returns the public key that signed an OCSP response: the
+// issuer's own key for a direct response, or a delegated responder
+// certificate's key once that certificate is confirmed to be signed by the
+// issuer.
+func ocspResponderKey(basic *basicOCSPResponse, issuer *x509.Certificate) (crypto.PublicKey, error) {
+	if len(basic.Certs) == 0 {
+		return issuer.PublicKey, nil
+	}
+	responder, err := x509.ParseCertificate(basic.Certs[0].FullBytes)
+	if err != nil {
+		return nil, fmt.Errorf("ocsp: failed to parse delegated responder certificate: %v", err)
+	}
+	if err := issuer.CheckSignature(responder.SignatureAlgorithm, responder.RawTBSCertificate, responder.Signature); err != nil {
+		return nil, fmt.Errorf("ocsp: delegated responder certificate is not signed by the issuer: %v", err)
+	}
+	return responder.PublicKey, nil
+}
+
+func checkOCSP(ctx context.Context, xcert *x509.Certificate, opts CheckRevocationOptions) (Revocation, error) {
+	if opts.IssuerCert == nil {
+		return Revocation{}, errors.New("ocsp: no issuer certificate supplied")
+	}
+	if len(xcert.OCSPServer) == 0 {
+		return Revocation{}, errors.New("ocsp: certificate has no OCSP responder URL")
+	}
+
+	reqDER, err := buildOCSPRequest(xcert, opts.IssuerCert)
+	if err != nil {
+		return Revocation{}, err
+	}
+
+	url := xcert.OCSPServer[0]
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(reqDER))
+	if err != nil {
+		return Revocation{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/ocsp-request")
+
+	resp, err := opts.HTTPClient.Do(httpReq)
+	if err != nil {
+		return Revocation{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Revocation{}, fmt.Errorf("ocsp: unexpected status from %s: %s", url, resp.Status)
+	}
+	respDER, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Revocation{}, err
+	}
+
+	basic, rd, err := parseOCSPResponse(respDER)
+	if err != nil {
+		return Revocation{}, err
+	}
+	if len(rd.Responses) == 0 {
+		return Revocation{}, errors.New("ocsp: response contained no certificate statuses")
+	}
+	var single *ocspSingleResponse
+	for i := range rd.Responses {
+		if matchesCertID(rd.Responses[i].CertID, xcert, opts.IssuerCert) {
+			single = &rd.Responses[i]
+			break
+		}
+	}
+	if single == nil {
+		return Revocation{}, errors.New("ocsp: response did not include a status for the requested certificate")
+	}
+
+	sigValid := false
+	if responderKey, err := ocspResponderKey(basic, opts.IssuerCert); err == nil {
+		sigValid = verifyOCSPSignature(responderKey, basic.SignatureAlgorithm, basic.TBSResponseData.FullBytes, basic.Signature.RightAlign()) == nil &&
+			issuerTrusted(opts.IssuerCert, opts.TrustStoreName)
+	}
+
+	rev := Revocation{
+		CheckedAt:      time.Now().UTC(),
+		Source:         "OCSP",
+		ResponderURL:   url,
+		SignatureValid: sigValid,
+	}
+
+	switch {
+	case single.CertStatus.Tag == 0:
+		rev.Status = RevocationStatusGood
+	case single.CertStatus.Tag == 1:
+		rev.Status = RevocationStatusRevoked
+		var info ocspRevokedInfo
+		if _, err := asn1.Unmarshal(reTagSequence(single.CertStatus), &info); err == nil {
+			t := info.RevocationTime.UTC()
+			rev.RevokedAt = &t
+			rev.Reason = revocationReasonName(int(info.RevocationReason))
+		}
+	default:
+		rev.Status = RevocationStatusUnknown
+	}
+	return rev, nil
+}
+
+// --- background refresher ---
+
+// RevocationRefreshItem pairs a certificate due for a revocation recheck
+// with the certificate that issued it. A refresh batch spans every
+// certificate in a real scan database, which means many different issuing
+// CAs -- resolving the right issuer per certificate (by AKI, by stored
+// chain, ...) is inherently store-specific, so NearExpiry hands it back
+// already resolved rather than RevocationRefresher pinning one static
+// issuer for the whole batch.
+type RevocationRefreshItem struct {
+	Cert   Certificate
+	Issuer *x509.Certificate
+}
+
+// RevocationResultStore persists Certificate revocation results so the
+// database layer can answer "was this cert revoked at time T" queries.
+// This package only defines the interface it needs from storage; wiring in
+// a concrete implementation is left to whatever owns the DB schema.
+type RevocationResultStore interface {
+	NearExpiry(within time.Duration) ([]RevocationRefreshItem, error)
+	Save(cert Certificate, rev Revocation) error
+}
+
+// RevocationRefresher periodically re-checks revocation results that are
+// close to going stale (within their CRL/OCSP response's validity window),
+// so long-lived scan results don't silently fall out of date.
+type RevocationRefresher struct {
+	Store    RevocationResultStore
+	Opts     CheckRevocationOptions
+	Interval time.Duration
+}
+
+// Run starts the refresh loop, blocking until ctx is canceled.
+func (r *RevocationRefresher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			r.refreshOnce(ctx)
+		}
+	}
+}
+
+func (r *RevocationRefresher) refreshOnce(ctx context.Context) {
+	const nearExpiryWindow = 24 * time.Hour
+
+	items, err := r.Store.NearExpiry(nearExpiryWindow)
+	if err != nil {
+		log.Printf("revocation refresher: failed to list near-expiry certificates: %v. Continuing anyway.", err)
+		return
+	}
+	for _, item := range items {
+		opts := r.Opts
+		opts.IssuerCert = item.Issuer
+
+		rev, err := item.Cert.CheckRevocation(ctx, opts)
+		if err != nil {
+			log.Printf("revocation refresher: failed to recheck %s: %v. Continuing anyway.", item.Cert.Serial, err)
+			continue
+		}
+		if err := r.Store.Save(item.Cert, rev); err != nil {
+			log.Printf("revocation refresher: failed to persist result for %s: %v. Continuing anyway.", item.Cert.Serial, err)
+		}
+	}
+}
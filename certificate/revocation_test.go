@@ -0,0 +1,298 @@
+package certificate
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRevocationReasonName(t *testing.T) {
+	cases := []struct {
+		code int
+		want string
+	}{
+		{0, "Unspecified"},
+		{1, "KeyCompromise"},
+		{5, "CessationOfOperation"},
+		{9, "PrivilegeWithdrawn"},
+		{7, "Unknown(7)"},   // reserved, never assigned
+		{99, "Unknown(99)"}, // out of range
+	}
+	for _, c := range cases {
+		if got := revocationReasonName(c.code); got != c.want {
+			t.Errorf("revocationReasonName(%d) = %q, want %q", c.code, got, c.want)
+		}
+	}
+}
+
+// TestReTagSequence checks the CertStatus CHOICE workaround: rewriting an
+// IMPLICIT-tagged "revoked" arm as a plain SEQUENCE so it can be unmarshaled
+// with an ordinary struct, since asn1.Unmarshal has no native CHOICE support.
+func TestReTagSequence(t *testing.T) {
+	revokedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	info := ocspRevokedInfo{RevocationTime: revokedAt, RevocationReason: 1}
+	der, err := asn1.MarshalWithParams(info, "")
+	if err != nil {
+		t.Fatalf("failed to marshal test RevokedInfo: %v", err)
+	}
+	// Simulate the context-specific IMPLICIT [1] constructed tag CertStatus
+	// actually carries on the wire in place of the universal SEQUENCE tag.
+	implicit := append([]byte(nil), der...)
+	implicit[0] = 0xA1
+
+	raw := asn1.RawValue{FullBytes: implicit}
+	var got ocspRevokedInfo
+	if _, err := asn1.Unmarshal(reTagSequence(raw), &got); err != nil {
+		t.Fatalf("failed to unmarshal re-tagged RevokedInfo: %v", err)
+	}
+	if !got.RevocationTime.Equal(revokedAt) {
+		t.Errorf("RevocationTime = %v, want %v", got.RevocationTime, revokedAt)
+	}
+	if got.RevocationReason != 1 {
+		t.Errorf("RevocationReason = %d, want 1", got.RevocationReason)
+	}
+}
+
+func TestBuildOCSPRequest(t *testing.T) {
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Unix(0, 0).UTC(),
+		NotAfter:              time.Unix(0, 0).UTC().AddDate(10, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	issuerDER, err := x509.CreateCertificate(rand.Reader, issuerTemplate, issuerTemplate, &issuerKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerCert, err := x509.ParseCertificate(issuerDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "leaf.example.com"},
+		NotBefore:    time.Unix(0, 0).UTC(),
+		NotAfter:     time.Unix(0, 0).UTC().AddDate(1, 0, 0),
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, issuerCert, &leafKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafCert, err := x509.ParseCertificate(leafDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reqDER, err := buildOCSPRequest(leafCert, issuerCert)
+	if err != nil {
+		t.Fatalf("buildOCSPRequest: %v", err)
+	}
+
+	var req ocspRequestMessage
+	if _, err := asn1.Unmarshal(reqDER, &req); err != nil {
+		t.Fatalf("failed to unmarshal built OCSPRequest: %v", err)
+	}
+	if len(req.TBSRequest.RequestList) != 1 {
+		t.Fatalf("expected 1 Request, got %d", len(req.TBSRequest.RequestList))
+	}
+	got := req.TBSRequest.RequestList[0].ReqCert.SerialNumber
+	if got.Cmp(leafCert.SerialNumber) != 0 {
+		t.Errorf("CertID.SerialNumber = %v, want %v", got, leafCert.SerialNumber)
+	}
+
+	// matchesCertID must accept the CertID this same request carries...
+	if !matchesCertID(req.TBSRequest.RequestList[0].ReqCert, leafCert, issuerCert) {
+		t.Error("matchesCertID rejected the CertID built for this exact certificate/issuer pair")
+	}
+
+	// ...but reject it for a certificate with a different serial number or
+	// for an unrelated issuer -- checkOCSP relies on this to avoid trusting
+	// a response that actually answers for a different certificate.
+	otherLeafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(43),
+		Subject:      pkix.Name{CommonName: "other.example.com"},
+		NotBefore:    time.Unix(0, 0).UTC(),
+		NotAfter:     time.Unix(0, 0).UTC().AddDate(1, 0, 0),
+	}
+	otherLeafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherLeafDER, err := x509.CreateCertificate(rand.Reader, otherLeafTemplate, issuerCert, &otherLeafKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherLeafCert, err := x509.ParseCertificate(otherLeafDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matchesCertID(req.TBSRequest.RequestList[0].ReqCert, otherLeafCert, issuerCert) {
+		t.Error("matchesCertID accepted a CertID for a certificate with a different serial number")
+	}
+
+	otherIssuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherIssuerDER, err := x509.CreateCertificate(rand.Reader, issuerTemplate, issuerTemplate, &otherIssuerKey.PublicKey, otherIssuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherIssuerCert, err := x509.ParseCertificate(otherIssuerDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matchesCertID(req.TBSRequest.RequestList[0].ReqCert, leafCert, otherIssuerCert) {
+		t.Error("matchesCertID accepted a CertID for a different issuer")
+	}
+}
+
+// stubRevocationResultStore hands back a fixed set of RevocationRefreshItems
+// and records every certificate whose recheck result was saved.
+type stubRevocationResultStore struct {
+	items []RevocationRefreshItem
+	saved []Certificate
+}
+
+// recordingTransport records the body of every request it is sent and then
+// fails it, so CheckRevocation never reaches the network.
+type recordingTransport struct {
+	bodies [][]byte
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	rt.bodies = append(rt.bodies, body)
+	return nil, errors.New("recordingTransport: network disabled in tests")
+}
+
+func (s *stubRevocationResultStore) NearExpiry(time.Duration) ([]RevocationRefreshItem, error) {
+	return s.items, nil
+}
+
+func (s *stubRevocationResultStore) Save(cert Certificate, rev Revocation) error {
+	s.saved = append(s.saved, cert)
+	return nil
+}
+
+func TestRevocationRefresherUsesPerItemIssuer(t *testing.T) {
+	makeCA := func(cn string) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             time.Unix(0, 0).UTC(),
+			NotAfter:              time.Unix(0, 0).UTC().AddDate(10, 0, 0),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert, key
+	}
+	makeLeaf := func(serial int64, issuer *x509.Certificate, issuerKey *ecdsa.PrivateKey) *x509.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "leaf.example.com"},
+			NotBefore:    time.Unix(0, 0).UTC(),
+			NotAfter:     time.Unix(0, 0).UTC().AddDate(1, 0, 0),
+			OCSPServer:   []string{"http://ocsp.example.test"},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, issuer, &key.PublicKey, issuerKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	issuerA, keyA := makeCA("issuer A")
+	issuerB, keyB := makeCA("issuer B")
+	leaves := []*x509.Certificate{makeLeaf(1, issuerA, keyA), makeLeaf(2, issuerB, keyB)}
+
+	store := &stubRevocationResultStore{
+		items: []RevocationRefreshItem{
+			{Cert: Certificate{Serial: "1", Raw: base64.StdEncoding.EncodeToString(leaves[0].Raw)}, Issuer: issuerA},
+			{Cert: Certificate{Serial: "2", Raw: base64.StdEncoding.EncodeToString(leaves[1].Raw)}, Issuer: issuerB},
+		},
+	}
+
+	// Each leaf names an OCSP responder, so CheckRevocation builds an OCSP
+	// request from the issuer in its options. The transport records those
+	// requests and fails them, and with no CRL distribution point to fall
+	// back to every recheck errors out instead of reaching the network.
+	transport := &recordingTransport{}
+	refresher := &RevocationRefresher{
+		Store: store,
+		Opts: CheckRevocationOptions{
+			HTTPClient: &http.Client{Transport: transport},
+		},
+	}
+	refresher.refreshOnce(context.Background())
+
+	if len(transport.bodies) != len(store.items) {
+		t.Fatalf("expected %d OCSP requests, got %d", len(store.items), len(transport.bodies))
+	}
+	for i, body := range transport.bodies {
+		var req ocspRequestMessage
+		if _, err := asn1.Unmarshal(body, &req); err != nil {
+			t.Fatalf("failed to unmarshal OCSP request %d: %v", i, err)
+		}
+		if len(req.TBSRequest.RequestList) != 1 {
+			t.Fatalf("expected 1 Request in OCSP request %d, got %d", i, len(req.TBSRequest.RequestList))
+		}
+		reqCert := req.TBSRequest.RequestList[0].ReqCert
+		if !matchesCertID(reqCert, leaves[i], store.items[i].Issuer) {
+			t.Errorf("OCSP request %d was not built with its item's own issuer", i)
+		}
+		if matchesCertID(reqCert, leaves[i], store.items[1-i].Issuer) {
+			t.Errorf("OCSP request %d was built with the other item's issuer", i)
+		}
+	}
+	if len(store.saved) != 0 {
+		t.Errorf("expected no results saved since every recheck failed, got %d", len(store.saved))
+	}
+}
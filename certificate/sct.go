@@ -0,0 +1,361 @@
+package certificate
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// OIDs for the Certificate Transparency X.509v3 extensions defined in
+// RFC 6962: the poison extension marks a TBSCertificate as a precertificate
+// submitted for logging, and the SCTList extension carries the resulting
+// SCTs once embedded in the issued certificate.
+var (
+	oidExtensionCTPoison = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+	oidExtensionSCTList  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+)
+
+var sctHashAlgorithms = [...]string{
+	"none",
+	"md5",
+	"sha1",
+	"sha224",
+	"sha256",
+	"sha384",
+	"sha512",
+}
+
+var sctSignatureAlgorithms = [...]string{
+	"anonymous",
+	"rsa",
+	"dsa",
+	"ecdsa",
+}
+
+// SCTInfo holds a single Signed Certificate Timestamp extracted from a
+// certificate's embedded SCTList extension, as defined in RFC 6962 section
+// 3.3.
+type SCTInfo struct {
+	LogID              string `json:"logId,omitempty"`
+	Timestamp          int64  `json:"timestamp,omitempty"`
+	HashAlgorithm      string `json:"hashAlgorithm,omitempty"`
+	SignatureAlgorithm string `json:"signatureAlgorithm,omitempty"`
+	Signature          string `json:"signature,omitempty"`
+}
+
+// CTLog describes a known Certificate Transparency log, as published in a
+// log list, that VerifySCTs can check embedded SCTs against.
+type CTLog struct {
+	Description string
+	LogID       string // base64-encoded SHA-256 hash of the log's public key
+	Key         crypto.PublicKey
+}
+
+// SCTValidationResult reports whether an individual SCT's signature could
+// be verified against a known log's public key.
+type SCTValidationResult struct {
+	IsValid         bool   `json:"isValid,omitempty"`
+	ValidationError string `json:"validationError,omitempty"`
+}
+
+// getSCTs extracts the embedded SCTList extension (if any) and reports
+// whether the certificate carries the CT poison extension, which marks it
+// as a precertificate rather than a certificate that can be served over
+// TLS.
+func getSCTs(cert *x509.Certificate) ([]SCTInfo, bool) {
+	var (
+		scts      []SCTInfo
+		isPrecert bool
+	)
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidExtensionCTPoison):
+			isPrecert = true
+
+		case ext.Id.Equal(oidExtensionSCTList):
+			var raw []byte
+			if _, err := asn1.Unmarshal(ext.Value, &raw); err != nil {
+				log.Printf("Failed to unwrap SCTList extension: %v. Continuing anyway.", err)
+				continue
+			}
+			parsed, err := parseSCTList(raw)
+			if err != nil {
+				log.Printf("Failed to parse embedded SCTs: %v. Continuing anyway.", err)
+				continue
+			}
+			scts = parsed
+		}
+	}
+	return scts, isPrecert
+}
+
+// parseSCTList decodes a TLS-encoded SignedCertificateTimestampList, as
+// carried inside the SCTList X.509v3 extension.
+func parseSCTList(raw []byte) ([]SCTInfo, error) {
+	if len(raw) < 2 {
+		return nil, errors.New("sct list: truncated length prefix")
+	}
+	listLen := int(binary.BigEndian.Uint16(raw[0:2]))
+	data := raw[2:]
+	if len(data) != listLen {
+		return nil, fmt.Errorf("sct list: length mismatch, want %d got %d", listLen, len(data))
+	}
+
+	var scts []SCTInfo
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, errors.New("sct list: truncated entry length")
+		}
+		sctLen := int(binary.BigEndian.Uint16(data[0:2]))
+		data = data[2:]
+		if len(data) < sctLen {
+			return nil, errors.New("sct list: truncated entry")
+		}
+		sct, err := parseSCT(data[:sctLen])
+		if err != nil {
+			return nil, err
+		}
+		scts = append(scts, sct)
+		data = data[sctLen:]
+	}
+	return scts, nil
+}
+
+// parseSCT decodes a single SignedCertificateTimestamp structure.
+func parseSCT(data []byte) (SCTInfo, error) {
+	var sct SCTInfo
+
+	if len(data) < 1+32+8+2 {
+		return sct, errors.New("sct: truncated")
+	}
+	version := data[0]
+	if version != 0 {
+		return sct, fmt.Errorf("sct: unsupported version %d", version)
+	}
+	logID := data[1:33]
+	timestamp := binary.BigEndian.Uint64(data[33:41])
+	data = data[41:]
+
+	extLen := int(binary.BigEndian.Uint16(data[0:2]))
+	data = data[2:]
+	if len(data) < extLen {
+		return sct, errors.New("sct: truncated extensions")
+	}
+	data = data[extLen:]
+
+	if len(data) < 2 {
+		return sct, errors.New("sct: truncated signature algorithm")
+	}
+	hashAlg := data[0]
+	sigAlg := data[1]
+	data = data[2:]
+
+	if len(data) < 2 {
+		return sct, errors.New("sct: truncated signature length")
+	}
+	sigLen := int(binary.BigEndian.Uint16(data[0:2]))
+	data = data[2:]
+	if len(data) != sigLen {
+		return sct, fmt.Errorf("sct: signature length mismatch, want %d got %d", sigLen, len(data))
+	}
+
+	sct.LogID = base64.StdEncoding.EncodeToString(logID)
+	sct.Timestamp = int64(timestamp)
+	sct.HashAlgorithm = sctAlgorithmName(sctHashAlgorithms[:], hashAlg)
+	sct.SignatureAlgorithm = sctAlgorithmName(sctSignatureAlgorithms[:], sigAlg)
+	sct.Signature = base64.StdEncoding.EncodeToString(data)
+	return sct, nil
+}
+
+func sctAlgorithmName(names []string, id byte) string {
+	if int(id) < len(names) {
+		return names[id]
+	}
+	return "unknown"
+}
+
+// tbsCertificate mirrors the ASN.1 TBSCertificate grammar from RFC 5280,
+// keeping fields we don't need to inspect as raw values so that removing an
+// extension and re-marshaling reproduces the original encoding byte for
+// byte.
+type tbsCertificate struct {
+	Raw                asn1.RawContent
+	Version            int `asn1:"optional,explicit,default:0,tag:0"`
+	SerialNumber       asn1.RawValue
+	SignatureAlgorithm asn1.RawValue
+	Issuer             asn1.RawValue
+	Validity           asn1.RawValue
+	Subject            asn1.RawValue
+	PublicKey          asn1.RawValue
+	UniqueId           asn1.BitString   `asn1:"optional,tag:1"`
+	SubjectUniqueId    asn1.BitString   `asn1:"optional,tag:2"`
+	Extensions         []pkix.Extension `asn1:"optional,explicit,tag:3"`
+}
+
+// tbsWithoutExtension re-encodes a certificate's TBSCertificate with the
+// given extension OID removed, which is what CT logs actually sign over:
+// a precertificate's TBSCertificate has its poison extension stripped, and
+// an issued certificate's embedded SCTs were signed before its SCTList
+// extension was added.
+func tbsWithoutExtension(rawTBS []byte, oid asn1.ObjectIdentifier) ([]byte, error) {
+	var tbs tbsCertificate
+	if _, err := asn1.Unmarshal(rawTBS, &tbs); err != nil {
+		return nil, fmt.Errorf("sct: failed to parse TBSCertificate: %v", err)
+	}
+	tbs.Raw = nil
+
+	kept := tbs.Extensions[:0]
+	for _, ext := range tbs.Extensions {
+		if !ext.Id.Equal(oid) {
+			kept = append(kept, ext)
+		}
+	}
+	tbs.Extensions = kept
+
+	return asn1.Marshal(tbs)
+}
+
+// precertSignedEntry builds the RFC 6962 PreCert structure (issuer key hash
+// followed by the length-prefixed TBSCertificate) that is hashed as part of
+// an SCT's signature input.
+func precertSignedEntry(issuerKeyHash, tbs []byte) []byte {
+	entry := make([]byte, 0, len(issuerKeyHash)+3+len(tbs))
+	entry = append(entry, issuerKeyHash...)
+	entry = append(entry, byte(len(tbs)>>16), byte(len(tbs)>>8), byte(len(tbs)))
+	entry = append(entry, tbs...)
+	return entry
+}
+
+// sctSignedData assembles the "digitally-signed" TimestampedEntry structure
+// that an SCT's signature was computed over (RFC 6962 section 3.2), for a
+// precert_entry leaf.
+func sctSignedData(sct SCTInfo, signedEntry []byte) []byte {
+	data := make([]byte, 0, 12+len(signedEntry)+2)
+	data = append(data, 0) // sct_version = v1
+	data = append(data, 0) // signature_type = certificate_timestamp
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(sct.Timestamp))
+	data = append(data, ts[:]...)
+	data = append(data, 0, 1) // entry_type = precert_entry
+	data = append(data, signedEntry...)
+	data = append(data, 0, 0) // no CtExtensions
+	return data
+}
+
+// issuerKeyHash derives the SHA-256 hash of the issuer's
+// SubjectPublicKeyInfo required to verify a precert_entry SCT. AuthorityKeyId
+// is not a substitute: almost every CA populates it as a SHA-1 key
+// identifier (RFC 5280's first recommended method), an unrelated value that
+// only coincidentally shares "hash of issuer key" framing with what RFC 6962
+// actually requires here.
+func issuerKeyHash(issuer *x509.Certificate) []byte {
+	hash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+	return hash[:]
+}
+
+// verifySCTSignature checks an SCT's signature over signedData against a
+// log's public key.
+func verifySCTSignature(pub crypto.PublicKey, sct SCTInfo, signedData []byte) error {
+	sig, err := base64.StdEncoding.DecodeString(sct.Signature)
+	if err != nil {
+		return fmt.Errorf("sct: invalid signature encoding: %v", err)
+	}
+	digest := sha256.Sum256(signedData)
+
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest[:], sig) {
+			return errors.New("sct: ECDSA signature verification failed")
+		}
+		return nil
+	default:
+		return fmt.Errorf("sct: unsupported log public key type %T", pub)
+	}
+}
+
+// VerifySCTs rebuilds the precertificate TBS that each embedded SCT was
+// signed over and verifies its signature against the matching log in
+// logList, keyed by SCTInfo.LogID. issuer is the certificate that issued c
+// and is required to compute the RFC 6962 issuer_key_hash; without it,
+// every SCT is reported unverifiable. Logs that VerifySCTs doesn't
+// recognize, or SCTs it cannot build verifiable input for, get a result
+// with IsValid false and an explanatory ValidationError rather than being
+// dropped. The result is also stored on c.SCTValidation, so it persists
+// alongside ValidationInfo instead of only being available to whoever
+// happened to call this method.
+func (c *Certificate) VerifySCTs(logList []CTLog, issuer *x509.Certificate) map[string]SCTValidationResult {
+	results := make(map[string]SCTValidationResult, len(c.SCTs))
+	if len(c.SCTs) == 0 {
+		return results
+	}
+
+	xcert, err := c.ToX509()
+	if err != nil {
+		for _, sct := range c.SCTs {
+			results[sct.LogID] = SCTValidationResult{
+				ValidationError: fmt.Sprintf("sct: failed to reparse certificate: %v", err),
+			}
+		}
+		c.SCTValidation = results
+		return results
+	}
+
+	if issuer == nil {
+		for _, sct := range c.SCTs {
+			results[sct.LogID] = SCTValidationResult{
+				ValidationError: "sct: no issuer certificate supplied; verifying an embedded SCT requires hashing the issuer's SubjectPublicKeyInfo",
+			}
+		}
+		c.SCTValidation = results
+		return results
+	}
+
+	logsByID := make(map[string]CTLog, len(logList))
+	for _, l := range logList {
+		logsByID[l.LogID] = l
+	}
+
+	extOID := oidExtensionSCTList
+	if c.IsPrecertificate {
+		extOID = oidExtensionCTPoison
+	}
+	tbs, tbsErr := tbsWithoutExtension(xcert.RawTBSCertificate, extOID)
+	keyHash := issuerKeyHash(issuer)
+
+	for _, sct := range c.SCTs {
+		res := SCTValidationResult{}
+
+		ctLog, ok := logsByID[sct.LogID]
+		if !ok {
+			res.ValidationError = "sct: unknown CT log " + sct.LogID
+			results[sct.LogID] = res
+			continue
+		}
+
+		switch {
+		case tbsErr != nil:
+			res.ValidationError = tbsErr.Error()
+		default:
+			signedEntry := precertSignedEntry(keyHash, tbs)
+			if err := verifySCTSignature(ctLog.Key, sct, sctSignedData(sct, signedEntry)); err != nil {
+				res.ValidationError = err.Error()
+			} else {
+				res.IsValid = true
+			}
+		}
+		results[sct.LogID] = res
+	}
+	c.SCTValidation = results
+	return results
+}
@@ -0,0 +1,200 @@
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// buildSCTListExtensionValue TLS-encodes a single SCT and wraps it the way
+// RFC 6962 requires: as an OCTET STRING nested inside the extension's own
+// extnValue OCTET STRING.
+func buildSCTListExtensionValue(t *testing.T, logID [32]byte, timestamp int64, sig []byte) []byte {
+	t.Helper()
+
+	sct := make([]byte, 0, 1+32+8+2+2+2+len(sig))
+	sct = append(sct, 0) // sct_version = v1
+	sct = append(sct, logID[:]...)
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(timestamp))
+	sct = append(sct, ts[:]...)
+	sct = append(sct, 0, 0) // no CtExtensions
+	sct = append(sct, 4, 3) // hash_algorithm=sha256, signature_algorithm=ecdsa
+	var sigLen [2]byte
+	binary.BigEndian.PutUint16(sigLen[:], uint16(len(sig)))
+	sct = append(sct, sigLen[:]...)
+	sct = append(sct, sig...)
+
+	var sctLen [2]byte
+	binary.BigEndian.PutUint16(sctLen[:], uint16(len(sct)))
+	entry := append(append([]byte{}, sctLen[:]...), sct...)
+
+	var listLen [2]byte
+	binary.BigEndian.PutUint16(listLen[:], uint16(len(entry)))
+	list := append(append([]byte{}, listLen[:]...), entry...)
+
+	der, err := asn1.Marshal(list)
+	if err != nil {
+		t.Fatalf("failed to wrap SCT list: %v", err)
+	}
+	return der
+}
+
+// TestVerifySCTsRoundTrip builds a real CA, issues a leaf certificate
+// carrying one embedded SCT signed exactly as RFC 6962 specifies, and
+// checks that VerifySCTs accepts it when given the real issuer and rejects
+// it against a different one -- the scenario the issuerKeyHash fix
+// (hashing the issuer's actual SubjectPublicKeyInfo instead of
+// AuthorityKeyId) needs to get right.
+func TestVerifySCTsRoundTrip(t *testing.T) {
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Unix(0, 0).UTC(),
+		NotAfter:              time.Unix(0, 0).UTC().AddDate(10, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	issuerDER, err := x509.CreateCertificate(rand.Reader, issuerTemplate, issuerTemplate, &issuerKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerCert, err := x509.ParseCertificate(issuerDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "leaf.example.com"},
+		NotBefore:    time.Unix(0, 0).UTC(),
+		NotAfter:     time.Unix(0, 0).UTC().AddDate(1, 0, 0),
+		DNSNames:     []string{"leaf.example.com"},
+	}
+
+	// Issue once without the SCTList extension to get the exact TBS bytes
+	// the SCT must be signed over.
+	presignDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, issuerCert, &leafKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	presignCert, err := x509.ParseCertificate(presignDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyHash := issuerKeyHash(issuerCert)
+	logID := sha256.Sum256([]byte("test-log"))
+	timestamp := int64(1700000000000)
+
+	sct := SCTInfo{Timestamp: timestamp}
+	signedEntry := precertSignedEntry(keyHash, presignCert.RawTBSCertificate)
+	digest := sha256.Sum256(sctSignedData(sct, signedEntry))
+
+	logKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := ecdsa.SignASN1(rand.Reader, logKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	extValue := buildSCTListExtensionValue(t, logID, timestamp, sig)
+	finalTemplate := *leafTemplate
+	finalTemplate.ExtraExtensions = []pkix.Extension{{Id: oidExtensionSCTList, Value: extValue}}
+	finalDER, err := x509.CreateCertificate(rand.Reader, &finalTemplate, issuerCert, &leafKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finalCert, err := x509.ParseCertificate(finalDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, _ := CertToStoredLax(finalCert, []*x509.Certificate{issuerCert}, "", "leaf.example.com", "", "", nil)
+	if len(stored.SCTs) != 1 {
+		t.Fatalf("expected 1 embedded SCT, got %d", len(stored.SCTs))
+	}
+	logIDStr := stored.SCTs[0].LogID
+
+	results := stored.VerifySCTs([]CTLog{{LogID: logIDStr, Key: &logKey.PublicKey}}, issuerCert)
+	res, ok := results[logIDStr]
+	if !ok {
+		t.Fatalf("no result for log %s", logIDStr)
+	}
+	if !res.IsValid {
+		t.Fatalf("expected valid SCT, got error: %s", res.ValidationError)
+	}
+	if got, want := stored.SCTValidation[logIDStr], res; got != want {
+		t.Fatalf("VerifySCTs result not stored on Certificate.SCTValidation: got %+v, want %+v", got, want)
+	}
+
+	// A differently-keyed issuer must not coincidentally verify: this is
+	// exactly the bug AuthorityKeyId-as-issuerKeyHash could hide, since
+	// AuthorityKeyId doesn't change across issuers that share an AKI
+	// convention.
+	wrongIssuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongIssuerDER, err := x509.CreateCertificate(rand.Reader, issuerTemplate, issuerTemplate, &wrongIssuerKey.PublicKey, wrongIssuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongIssuerCert, err := x509.ParseCertificate(wrongIssuerDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	badResults := stored.VerifySCTs([]CTLog{{LogID: logIDStr, Key: &logKey.PublicKey}}, wrongIssuerCert)
+	if badResults[logIDStr].IsValid {
+		t.Fatalf("expected SCT verification to fail against the wrong issuer")
+	}
+}
+
+func TestSCTListRoundTrip(t *testing.T) {
+	logID := sha256.Sum256([]byte("another-log"))
+	sig := []byte{0x01, 0x02, 0x03}
+	extValue := buildSCTListExtensionValue(t, logID, 42, sig)
+
+	var raw []byte
+	if _, err := asn1.Unmarshal(extValue, &raw); err != nil {
+		t.Fatalf("failed to unwrap SCT list OCTET STRING: %v", err)
+	}
+
+	scts, err := parseSCTList(raw)
+	if err != nil {
+		t.Fatalf("parseSCTList: %v", err)
+	}
+	if len(scts) != 1 {
+		t.Fatalf("expected 1 SCT, got %d", len(scts))
+	}
+	if got, want := scts[0].LogID, base64.StdEncoding.EncodeToString(logID[:]); got != want {
+		t.Errorf("LogID = %q, want %q", got, want)
+	}
+	if got, want := scts[0].Timestamp, int64(42); got != want {
+		t.Errorf("Timestamp = %d, want %d", got, want)
+	}
+	if got, want := scts[0].Signature, base64.StdEncoding.EncodeToString(sig); got != want {
+		t.Errorf("Signature = %q, want %q", got, want)
+	}
+}
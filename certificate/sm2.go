@@ -0,0 +1,90 @@
+package certificate
+
+import (
+	"crypto/elliptic"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+)
+
+// SM2 (GB/T 32918) public-key and SM2-with-SM3 signature OIDs, used by
+// Chinese banking, government, and IoT certificates that crypto/x509
+// doesn't recognize on its own.
+var (
+	oidPublicKeySM2        = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301}
+	oidSignatureSM2WithSM3 = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 501}
+)
+
+// sm2Curve holds the domain parameters of the SM2 recommended curve
+// (sm2p256v1, GB/T 32918.5 Annex A). crypto/elliptic has no built-in support
+// for it, but its "a" coefficient equals p-3 just like the NIST curves, so
+// crypto/elliptic's generic CurveParams arithmetic (which assumes a = -3)
+// still produces correct results.
+var sm2Curve = newSM2Curve()
+
+func newSM2Curve() elliptic.Curve {
+	c := &elliptic.CurveParams{Name: "SM2P256V1", BitSize: 256}
+	c.P, _ = new(big.Int).SetString("FFFFFFFEFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF00000000FFFFFFFFFFFFFFFF", 16)
+	c.N, _ = new(big.Int).SetString("FFFFFFFEFFFFFFFFFFFFFFFFFFFFFFFF7203DF6B21C6052B53BBF40939D54123", 16)
+	c.B, _ = new(big.Int).SetString("28E9FA9E9D9F5E344D5A9E4BCF6509A7F39789F515AB8F92DDBCBD414D940E93", 16)
+	c.Gx, _ = new(big.Int).SetString("32C4AE2C1F1981195F9904466A39C9948FE30BBFF2660BE1715A4589334C74C7", 16)
+	c.Gy, _ = new(big.Int).SetString("BC3736A2F4F6779C59BDCEE36B692153D0A9877CC62A474002DF32E52139F0A0", 16)
+	return c
+}
+
+// rawSubjectPublicKeyInfo mirrors pkix.PublicKeyInfo, used to reach the raw
+// algorithm OID and key bits crypto/x509 leaves unparsed for algorithms it
+// doesn't recognize, such as SM2.
+type rawSubjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// parseSM2PublicKey extracts the affine coordinates of an SM2 public key
+// from a certificate's raw SubjectPublicKeyInfo, which crypto/x509 leaves
+// as a nil cert.PublicKey since it doesn't recognize the SM2 OID.
+func parseSM2PublicKey(rawSPKI []byte) (x, y *big.Int, err error) {
+	var spki rawSubjectPublicKeyInfo
+	if _, err = asn1.Unmarshal(rawSPKI, &spki); err != nil {
+		return nil, nil, err
+	}
+	if !spki.Algorithm.Algorithm.Equal(oidPublicKeySM2) {
+		return nil, nil, errors.New("not an SM2 public key")
+	}
+	x, y = elliptic.Unmarshal(sm2Curve, spki.PublicKey.RightAlign())
+	if x == nil {
+		return nil, nil, errors.New("invalid SM2 public key point")
+	}
+	return x, y, nil
+}
+
+// marshalRawSPKI re-encodes a SubjectPublicKeyInfo for a key algorithm
+// x509.MarshalPKIXPublicKey doesn't know how to produce a DER encoding for,
+// using the algorithm OID and key bits straight off the certificate's own
+// raw SubjectPublicKeyInfo. This keeps PKPSHA256Hash pinnable for SM2 (and
+// any other algorithm crypto/x509 merely leaves opaque) without needing a
+// parsed key of a recognized Go type.
+func marshalRawSPKI(rawSPKI []byte) ([]byte, error) {
+	var spki rawSubjectPublicKeyInfo
+	if _, err := asn1.Unmarshal(rawSPKI, &spki); err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(spki)
+}
+
+// isSM2WithSM3 reports whether a certificate was signed with SM2-with-SM3,
+// which crypto/x509 doesn't recognize and so always reports as
+// UnknownSignatureAlgorithm.
+func isSM2WithSM3(cert *x509.Certificate) bool {
+	var tbs tbsCertificate
+	if _, err := asn1.Unmarshal(cert.RawTBSCertificate, &tbs); err != nil {
+		return false
+	}
+	var algID pkix.AlgorithmIdentifier
+	if _, err := asn1.Unmarshal(tbs.SignatureAlgorithm.FullBytes, &algID); err != nil {
+		return false
+	}
+	return algID.Algorithm.Equal(oidSignatureSM2WithSM3)
+}
@@ -0,0 +1,64 @@
+package certificate
+
+import (
+	"crypto/elliptic"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+)
+
+// TestSM2CurveGeneratorIsOnCurve confirms the hand-entered sm2p256v1 domain
+// parameters describe a consistent curve: if P/B/Gx/Gy didn't agree, every
+// SM2 key parsed against sm2Curve would silently produce nonsense points.
+func TestSM2CurveGeneratorIsOnCurve(t *testing.T) {
+	params := sm2Curve.Params()
+	if !sm2Curve.IsOnCurve(params.Gx, params.Gy) {
+		t.Fatal("sm2p256v1 base point is not on the configured curve")
+	}
+}
+
+func marshalSM2SPKI(t *testing.T, x, y *big.Int) []byte {
+	t.Helper()
+	point := elliptic.Marshal(sm2Curve, x, y)
+	spki := rawSubjectPublicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidPublicKeySM2},
+		PublicKey: asn1.BitString{Bytes: point, BitLength: len(point) * 8},
+	}
+	der, err := asn1.Marshal(spki)
+	if err != nil {
+		t.Fatalf("failed to marshal test SPKI: %v", err)
+	}
+	return der
+}
+
+func TestParseSM2PublicKeyRoundTrip(t *testing.T) {
+	params := sm2Curve.Params()
+	der := marshalSM2SPKI(t, params.Gx, params.Gy)
+
+	x, y, err := parseSM2PublicKey(der)
+	if err != nil {
+		t.Fatalf("parseSM2PublicKey: %v", err)
+	}
+	if x.Cmp(params.Gx) != 0 || y.Cmp(params.Gy) != 0 {
+		t.Fatalf("parsed point (%x, %x) doesn't match the encoded one (%x, %x)", x, y, params.Gx, params.Gy)
+	}
+
+	if _, err := marshalRawSPKI(der); err != nil {
+		t.Fatalf("marshalRawSPKI: %v", err)
+	}
+}
+
+func TestParseSM2PublicKeyWrongAlgorithm(t *testing.T) {
+	spki := rawSubjectPublicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}}, // id-ecPublicKey
+		PublicKey: asn1.BitString{Bytes: []byte{0x04}, BitLength: 8},
+	}
+	der, err := asn1.Marshal(spki)
+	if err != nil {
+		t.Fatalf("failed to marshal test SPKI: %v", err)
+	}
+	if _, _, err := parseSM2PublicKey(der); err == nil {
+		t.Fatal("expected an error parsing a non-SM2 algorithm OID as an SM2 key")
+	}
+}
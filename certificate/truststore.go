@@ -0,0 +1,361 @@
+package certificate
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+var (
+	trustStoresMu sync.RWMutex
+	trustStores   = make(map[string]TrustStore)
+)
+
+// RegisterTrustStore adds (or replaces) a named trust store. Every
+// registered store becomes available to validate certificates against,
+// without requiring any change to this package: enterprise/internal CAs,
+// the Java cacerts bundle, or region-specific stores like CFCA/GB can all
+// be added by a caller at startup.
+func RegisterTrustStore(ts TrustStore) {
+	trustStoresMu.Lock()
+	defer trustStoresMu.Unlock()
+	trustStores[ts.Name] = ts
+}
+
+// TrustStoreByName returns the registered trust store with the given name,
+// if any.
+func TrustStoreByName(name string) (TrustStore, bool) {
+	trustStoresMu.RLock()
+	defer trustStoresMu.RUnlock()
+	ts, ok := trustStores[name]
+	return ts, ok
+}
+
+// TrustStoreNames returns the names of all currently registered trust
+// stores, sorted for stable iteration (e.g. when building DB columns or
+// ranging for validation).
+func TrustStoreNames() []string {
+	trustStoresMu.RLock()
+	defer trustStoresMu.RUnlock()
+	names := make([]string, 0, len(trustStores))
+	for name := range trustStores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateAgainstRegistry verifies cert against every currently registered
+// trust store and returns a ValidationInfo keyed by store name, suitable
+// for merging onto Certificate.ValidationInfo. Registering a new trust
+// store via RegisterTrustStore takes effect for every certificate parsed
+// afterwards without callers having to enumerate stores themselves.
+//
+// intermediates is the certificate's chain of intermediate CAs, if any. In
+// virtually every real TLS deployment the leaf being scanned is signed by
+// an intermediate rather than directly by a root, so without it almost
+// every otherwise-trusted certificate would fail with "certificate signed
+// by unknown authority".
+func ValidateAgainstRegistry(cert *x509.Certificate, intermediates []*x509.Certificate) map[string]ValidationInfo {
+	var pool *x509.CertPool
+	if len(intermediates) > 0 {
+		pool = x509.NewCertPool()
+		for _, ic := range intermediates {
+			pool.AddCert(ic)
+		}
+	}
+
+	info := make(map[string]ValidationInfo, len(trustStores))
+	for _, name := range TrustStoreNames() {
+		ts, ok := TrustStoreByName(name)
+		if !ok {
+			continue
+		}
+		_, err := cert.Verify(x509.VerifyOptions{Roots: ts.Certs, Intermediates: pool})
+		if err != nil {
+			info[name] = ValidationInfo{IsValid: false, ValidationError: err.Error()}
+		} else {
+			info[name] = ValidationInfo{IsValid: true}
+		}
+	}
+	return info
+}
+
+// TrustMap reduces a certificate's ValidationInfo down to a simple
+// per-store pass/fail map, for callers (e.g. DB row builders) that don't
+// need the validation error detail. It covers every store ValidationInfo
+// was populated for, not just the five Observatory originally shipped
+// with.
+func (c Certificate) TrustMap() map[string]bool {
+	m := make(map[string]bool, len(c.ValidationInfo))
+	for name, info := range c.ValidationInfo {
+		m[name] = info.IsValid
+	}
+	return m
+}
+
+// ToTrust projects a certificate's ValidationInfo down onto the legacy
+// five-boolean Trust schema, for readers still pinned to it. Any other
+// registered store's result is left unrepresented.
+//
+// Deprecated: use TrustMap, which covers every registered trust store.
+func (c Certificate) ToTrust() Trust {
+	return TrustFromMap(c.TrustMap())
+}
+
+// TrustFromMap builds the legacy Trust schema from a store-name keyed map,
+// e.g. one produced by TrustMap.
+//
+// Deprecated: use a map[string]bool (or ValidationInfo) keyed by
+// RegisterTrustStore name instead of the fixed five-boolean schema.
+func TrustFromMap(b map[string]bool) Trust {
+	return Trust{
+		TrustUbuntu:      b[Ubuntu_TS_name],
+		TrustMozilla:     b[Mozilla_TS_name],
+		TrustedMicrosoft: b[Microsoft_TS_name],
+		TrustedApple:     b[Apple_TS_name],
+		TrustedAndroid:   b[Android_TS_name],
+	}
+}
+
+// LoadPEMTrustStore reads a PEM bundle of trusted root certificates,
+// registers it under name, and returns the resulting TrustStore.
+func LoadPEMTrustStore(name string, pemBundle []byte) (TrustStore, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemBundle) {
+		return TrustStore{}, fmt.Errorf("truststore %q: no certificates found in PEM bundle", name)
+	}
+	ts := TrustStore{Name: name, Certs: pool}
+	RegisterTrustStore(ts)
+	return ts, nil
+}
+
+// LoadNSSTrustStore parses Mozilla NSS's certdata.txt format (as shipped in
+// the nss source tree) and registers every CKO_CERTIFICATE object it finds
+// as a trusted root under name.
+//
+// certdata.txt encodes certificate bytes as MULTILINE_OCTAL blocks rather
+// than PEM/DER, and also carries per-purpose CKO_NSS_TRUST objects
+// alongside each certificate; this loader only extracts the raw
+// certificates, it does not yet honor explicit per-purpose distrust
+// records.
+func LoadNSSTrustStore(name string, certdata []byte) (TrustStore, error) {
+	pool := x509.NewCertPool()
+	count := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(certdata))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var inValue bool
+	var octal []byte
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case inValue:
+			if line == "END" {
+				if cert, err := x509.ParseCertificate(decodeMultilineOctal(octal)); err == nil {
+					pool.AddCert(cert)
+					count++
+				}
+				inValue = false
+				octal = nil
+				continue
+			}
+			octal = append(octal, line...)
+
+		case line == "CKA_VALUE MULTILINE_OCTAL":
+			inValue = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return TrustStore{}, fmt.Errorf("truststore %q: failed to read certdata.txt: %v", name, err)
+	}
+	if count == 0 {
+		return TrustStore{}, fmt.Errorf("truststore %q: no certificates found in certdata.txt", name)
+	}
+
+	ts := TrustStore{Name: name, Certs: pool}
+	RegisterTrustStore(ts)
+	return ts, nil
+}
+
+// decodeMultilineOctal turns a certdata.txt MULTILINE_OCTAL block (a run of
+// "\NNN" octal byte escapes, one or more per line) into the raw DER bytes
+// it encodes.
+func decodeMultilineOctal(octal []byte) []byte {
+	der := make([]byte, 0, len(octal)/4)
+	for i := 0; i+3 < len(octal); {
+		if octal[i] != '\\' {
+			i++
+			continue
+		}
+		v := (int(octal[i+1]-'0') << 6) | (int(octal[i+2]-'0') << 3) | int(octal[i+3]-'0')
+		der = append(der, byte(v))
+		i += 4
+	}
+	return der
+}
+
+const (
+	jksMagic          = 0xFEEDFEED
+	jksTagPrivateKey  = 1
+	jksTagTrustedCert = 2
+)
+
+// jksReader is a minimal big-endian cursor over a JKS keystore's bytes.
+type jksReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *jksReader) uint32() (uint32, error) {
+	if r.pos+4 > len(r.buf) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	v := binary.BigEndian.Uint32(r.buf[r.pos : r.pos+4])
+	r.pos += 4
+	return v, nil
+}
+
+func (r *jksReader) uint64() (uint64, error) {
+	if r.pos+8 > len(r.buf) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	v := binary.BigEndian.Uint64(r.buf[r.pos : r.pos+8])
+	r.pos += 8
+	return v, nil
+}
+
+func (r *jksReader) bytes(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.buf) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *jksReader) skip(n int) error {
+	_, err := r.bytes(n)
+	return err
+}
+
+// utf reads a JKS modified-UTF-8 string: a 2-byte length prefix followed by
+// that many bytes. Aliases and cert-type fields are ASCII in every
+// keystore this package has seen, so no UTF decoding is attempted beyond
+// treating the bytes as UTF-8.
+func (r *jksReader) utf() (string, error) {
+	if r.pos+2 > len(r.buf) {
+		return "", io.ErrUnexpectedEOF
+	}
+	n := int(binary.BigEndian.Uint16(r.buf[r.pos : r.pos+2]))
+	r.pos += 2
+	b, err := r.bytes(n)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// LoadJavaTrustStore parses a Java KeyStore (JKS) file and registers every
+// trustedCertEntry it contains as a trusted root under name. It does not
+// verify the keystore's own integrity digest (a trailing SHA-1 hash over
+// the password and entry stream): that digest only protects against the
+// keystore file being tampered with after export, which RegisterTrustStore
+// already has to trust the caller about for every other loader here.
+//
+// PKCS12 keystores are not supported: unlike JKS, extracting trust anchors
+// from one first requires decrypting a password-based-encrypted ASN.1
+// structure, which needs either stdlib support this package doesn't have
+// or a vendored dependency this snapshot doesn't carry.
+func LoadJavaTrustStore(name string, keystore []byte, password string) (TrustStore, error) {
+	r := &jksReader{buf: keystore}
+
+	magic, err := r.uint32()
+	if err != nil || magic != jksMagic {
+		return TrustStore{}, fmt.Errorf("truststore %q: not a JKS keystore", name)
+	}
+	if _, err := r.uint32(); err != nil { // format version, unused
+		return TrustStore{}, fmt.Errorf("truststore %q: truncated JKS header: %v", name, err)
+	}
+	count, err := r.uint32()
+	if err != nil {
+		return TrustStore{}, fmt.Errorf("truststore %q: truncated JKS header: %v", name, err)
+	}
+
+	pool := x509.NewCertPool()
+	found := 0
+	for i := uint32(0); i < count; i++ {
+		tag, err := r.uint32()
+		if err != nil {
+			return TrustStore{}, fmt.Errorf("truststore %q: truncated JKS entry %d: %v", name, i, err)
+		}
+		if _, err := r.utf(); err != nil { // alias
+			return TrustStore{}, fmt.Errorf("truststore %q: truncated JKS entry %d: %v", name, i, err)
+		}
+		if _, err := r.uint64(); err != nil { // creation timestamp
+			return TrustStore{}, fmt.Errorf("truststore %q: truncated JKS entry %d: %v", name, i, err)
+		}
+
+		switch tag {
+		case jksTagPrivateKey:
+			keyLen, err := r.uint32()
+			if err != nil {
+				return TrustStore{}, fmt.Errorf("truststore %q: truncated JKS entry %d: %v", name, i, err)
+			}
+			if err := r.skip(int(keyLen)); err != nil {
+				return TrustStore{}, fmt.Errorf("truststore %q: truncated JKS entry %d: %v", name, i, err)
+			}
+			chainLen, err := r.uint32()
+			if err != nil {
+				return TrustStore{}, fmt.Errorf("truststore %q: truncated JKS entry %d: %v", name, i, err)
+			}
+			for j := uint32(0); j < chainLen; j++ {
+				if _, err := r.utf(); err != nil { // cert type
+					return TrustStore{}, fmt.Errorf("truststore %q: truncated JKS entry %d chain cert %d: %v", name, i, j, err)
+				}
+				certLen, err := r.uint32()
+				if err != nil {
+					return TrustStore{}, fmt.Errorf("truststore %q: truncated JKS entry %d chain cert %d: %v", name, i, j, err)
+				}
+				if err := r.skip(int(certLen)); err != nil {
+					return TrustStore{}, fmt.Errorf("truststore %q: truncated JKS entry %d chain cert %d: %v", name, i, j, err)
+				}
+			}
+
+		case jksTagTrustedCert:
+			if _, err := r.utf(); err != nil { // cert type
+				return TrustStore{}, fmt.Errorf("truststore %q: truncated JKS entry %d: %v", name, i, err)
+			}
+			certLen, err := r.uint32()
+			if err != nil {
+				return TrustStore{}, fmt.Errorf("truststore %q: truncated JKS entry %d: %v", name, i, err)
+			}
+			der, err := r.bytes(int(certLen))
+			if err != nil {
+				return TrustStore{}, fmt.Errorf("truststore %q: truncated JKS entry %d: %v", name, i, err)
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return TrustStore{}, fmt.Errorf("truststore %q: unparseable certificate in JKS entry %d: %v", name, i, err)
+			}
+			pool.AddCert(cert)
+			found++
+
+		default:
+			return TrustStore{}, fmt.Errorf("truststore %q: unrecognized JKS entry tag %d", name, tag)
+		}
+	}
+	if found == 0 {
+		return TrustStore{}, fmt.Errorf("truststore %q: no trusted certificates found in JKS keystore", name)
+	}
+
+	ts := TrustStore{Name: name, Certs: pool}
+	RegisterTrustStore(ts)
+	return ts, nil
+}
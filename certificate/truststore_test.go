@@ -0,0 +1,97 @@
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// TestValidateAgainstRegistryUsesIntermediates builds a root -> intermediate
+// -> leaf chain, registers only the root, and checks that ValidateAgainstRegistry
+// still trusts the leaf once given its intermediate -- the near-universal
+// case for real TLS deployments, where the scanned leaf is never signed
+// directly by a root.
+func TestValidateAgainstRegistryUsesIntermediates(t *testing.T) {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root CA"},
+		NotBefore:             time.Now().Add(-time.Hour).UTC(),
+		NotAfter:              time.Now().AddDate(20, 0, 0).UTC(),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCert, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intermediateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediateTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "test intermediate CA"},
+		NotBefore:             time.Now().Add(-time.Hour).UTC(),
+		NotAfter:              time.Now().AddDate(10, 0, 0).UTC(),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	intermediateDER, err := x509.CreateCertificate(rand.Reader, intermediateTemplate, rootCert, &intermediateKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediateCert, err := x509.ParseCertificate(intermediateDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "leaf.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour).UTC(),
+		NotAfter:     time.Now().AddDate(1, 0, 0).UTC(),
+		DNSNames:     []string{"leaf.example.com"},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, intermediateCert, &leafKey.PublicKey, intermediateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafCert, err := x509.ParseCertificate(leafDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(rootCert)
+	RegisterTrustStore(TrustStore{Name: "test-root-only", Certs: pool})
+
+	withoutChain := ValidateAgainstRegistry(leafCert, nil)
+	if withoutChain["test-root-only"].IsValid {
+		t.Fatal("expected validation without the intermediate to fail, since Go's x509.Verify can't build the chain on its own")
+	}
+
+	withChain := ValidateAgainstRegistry(leafCert, []*x509.Certificate{intermediateCert})
+	if !withChain["test-root-only"].IsValid {
+		t.Fatalf("expected a legitimately trusted leaf to validate once its intermediate is supplied, got error: %s", withChain["test-root-only"].ValidationError)
+	}
+}